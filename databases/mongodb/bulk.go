@@ -0,0 +1,257 @@
+/**
+ * Copyright 2020 gd Author. All rights reserved.
+ * Author: Chuck1024
+ */
+
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/chuck1024/gd/dlog"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	DefaultBulkOps   = 1000
+	DefaultBulkBytes = 16 * 1024 * 1024
+)
+
+// BulkOption configures a BulkWriter returned by MongoClient.BufferedBulk.
+type BulkOption func(w *BulkWriter)
+
+// Ordered sets whether the underlying BulkWrite stops at the first error (true, the Mongo
+// default) or keeps applying the remaining models and aggregates every error (false).
+func Ordered(ordered bool) BulkOption {
+	return func(w *BulkWriter) {
+		w.ordered = ordered
+	}
+}
+
+// ContinueOnError is a convenience for Ordered(false): a flush applies every buffered model
+// and returns the aggregated BulkWriteError instead of aborting on the first failure.
+func ContinueOnError() BulkOption {
+	return Ordered(false)
+}
+
+// MaxOps overrides the number of buffered write models that triggers an automatic flush.
+func MaxOps(n int) BulkOption {
+	return func(w *BulkWriter) {
+		w.maxOps = n
+	}
+}
+
+// MaxBytes overrides the approximate buffered payload size (in bytes) that triggers an
+// automatic flush. It should stay under the server's maxBsonObjectSize/maxMessageSizeBytes.
+func MaxBytes(n int) BulkOption {
+	return func(w *BulkWriter) {
+		w.maxBytes = n
+	}
+}
+
+// BulkWriteResult aggregates the counters of every flush performed by a BulkWriter.
+type BulkWriteResult struct {
+	InsertedCount int64
+	MatchedCount  int64
+	ModifiedCount int64
+	DeletedCount  int64
+	UpsertedCount int64
+	UpsertedIDs   map[int64]interface{}
+}
+
+// BulkWriteError wraps a single flush's write errors. Each WriteError's Index is the failed
+// op's position among the models sent in that flush, so ContinueOnError callers can tell
+// which op failed; the models themselves are not kept.
+type BulkWriteError struct {
+	*mongo.BulkWriteException
+}
+
+func (e *BulkWriteError) Error() string {
+	return fmt.Sprintf("mongoClient bulk write occur error:%v", e.BulkWriteException)
+}
+
+// BulkWriter accumulates write models in memory and flushes them via Collection.BulkWrite
+// once a size or byte threshold is hit, or Flush/Close is called explicitly. It is not safe
+// for concurrent use.
+type BulkWriter struct {
+	client     *MongoClient
+	collection string
+
+	ordered  bool
+	maxOps   int
+	maxBytes int
+
+	models []mongo.WriteModel
+	bytes  int
+
+	// opsFlushed is the number of models sent across all prior flushes, so UpsertedIDs
+	// (which BulkWrite keys by index within a single call) can be merged into Result without
+	// different flushes' indices colliding.
+	opsFlushed int64
+
+	Result BulkWriteResult
+}
+
+// BufferedBulk returns a BulkWriter for collection. Defaults: ordered execution, flush at
+// DefaultBulkOps models or DefaultBulkBytes bytes, whichever comes first.
+func (m *MongoClient) BufferedBulk(collection string, opts ...BulkOption) *BulkWriter {
+	w := &BulkWriter{
+		client:     m,
+		collection: collection,
+		ordered:    true,
+		maxOps:     DefaultBulkOps,
+		maxBytes:   DefaultBulkBytes,
+		Result: BulkWriteResult{
+			UpsertedIDs: make(map[int64]interface{}),
+		},
+	}
+
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	return w
+}
+
+func (w *BulkWriter) add(model mongo.WriteModel, approxSize int) error {
+	w.models = append(w.models, model)
+	w.bytes += approxSize
+
+	if len(w.models) >= w.maxOps || w.bytes >= w.maxBytes {
+		return w.Flush()
+	}
+	return nil
+}
+
+// AddModel buffers a pre-built mongo.WriteModel directly, for callers (like migrate.Backfill)
+// that already produced the model themselves. Byte-threshold tracking is skipped for these
+// since there is no generic way to size an arbitrary WriteModel; only the op-count threshold
+// applies.
+func (w *BulkWriter) AddModel(model mongo.WriteModel) error {
+	return w.add(model, 0)
+}
+
+// InsertOne buffers an insert of doc.
+func (w *BulkWriter) InsertOne(doc interface{}) error {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return w.add(mongo.NewInsertOneModel().SetDocument(doc), len(raw))
+}
+
+// UpdateOne buffers an update of the first document matching filter.
+func (w *BulkWriter) UpdateOne(filter interface{}, update interface{}, upsert bool) error {
+	raw, err := bson.Marshal(update)
+	if err != nil {
+		return err
+	}
+	model := mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update).SetUpsert(upsert)
+	return w.add(model, len(raw))
+}
+
+// UpdateMany buffers an update of every document matching filter.
+func (w *BulkWriter) UpdateMany(filter interface{}, update interface{}, upsert bool) error {
+	raw, err := bson.Marshal(update)
+	if err != nil {
+		return err
+	}
+	model := mongo.NewUpdateManyModel().SetFilter(filter).SetUpdate(update).SetUpsert(upsert)
+	return w.add(model, len(raw))
+}
+
+// ReplaceOne buffers a whole-document replacement of the first document matching filter.
+func (w *BulkWriter) ReplaceOne(filter interface{}, replacement interface{}, upsert bool) error {
+	raw, err := bson.Marshal(replacement)
+	if err != nil {
+		return err
+	}
+	model := mongo.NewReplaceOneModel().SetFilter(filter).SetReplacement(replacement).SetUpsert(upsert)
+	return w.add(model, len(raw))
+}
+
+// DeleteOne buffers a delete of the first document matching filter.
+func (w *BulkWriter) DeleteOne(filter interface{}) error {
+	raw, err := bson.Marshal(filter)
+	if err != nil {
+		return err
+	}
+	return w.add(mongo.NewDeleteOneModel().SetFilter(filter), len(raw))
+}
+
+// DeleteMany buffers a delete of every document matching filter.
+func (w *BulkWriter) DeleteMany(filter interface{}) error {
+	raw, err := bson.Marshal(filter)
+	if err != nil {
+		return err
+	}
+	return w.add(mongo.NewDeleteManyModel().SetFilter(filter), len(raw))
+}
+
+// Flush sends whatever is currently buffered via Collection.BulkWrite, merges the result
+// into w.Result and resets the buffer. It is a no-op when nothing is buffered.
+func (w *BulkWriter) Flush() error {
+	if len(w.models) == 0 {
+		return nil
+	}
+
+	models := w.models
+	w.models = nil
+	w.bytes = 0
+
+	st := time.Now()
+	bulkOpts := options.BulkWriteOptions{}
+	bulkOpts.SetOrdered(w.ordered)
+
+	res, err := w.client.client.Database(w.client.DataBase).Collection(w.collection).BulkWrite(context.TODO(), models, &bulkOpts)
+	cost := time.Now().Sub(st) / time.Millisecond
+
+	if cost > MongoCommonCostMax {
+		dlog.Warn("mongoClient bulkWrite slow, collection:%s, ops:%d, cost:%dms, metric:%s", w.collection, len(models), cost, fmt.Sprintf(MongoCmdSlowCount, "bulkWrite"))
+	}
+
+	if err != nil {
+		if bulkErr, ok := err.(mongo.BulkWriteException); ok {
+			if res != nil {
+				w.mergeResult(res)
+			}
+			w.opsFlushed += int64(len(models))
+			return &BulkWriteError{&bulkErr}
+		}
+		dlog.Error("mongoClient BulkWrite occur error:%v, collection:%s", err, w.collection)
+		return err
+	}
+
+	w.mergeResult(res)
+	w.opsFlushed += int64(len(models))
+	return nil
+}
+
+// mergeResult folds one flush's BulkWriteResult into w.Result. res.UpsertedIDs is keyed by
+// the op's index within that single BulkWrite call, so it's offset by opsFlushed (the number
+// of ops sent in prior flushes) before merging - otherwise flush 2's index 0 would overwrite
+// flush 1's index 0.
+func (w *BulkWriter) mergeResult(res *mongo.BulkWriteResult) {
+	if res == nil {
+		return
+	}
+
+	w.Result.InsertedCount += res.InsertedCount
+	w.Result.MatchedCount += res.MatchedCount
+	w.Result.ModifiedCount += res.ModifiedCount
+	w.Result.DeletedCount += res.DeletedCount
+	w.Result.UpsertedCount += res.UpsertedCount
+	for k, v := range res.UpsertedIDs {
+		w.Result.UpsertedIDs[w.opsFlushed+k] = v
+	}
+}
+
+// Close flushes any remaining buffered models. Callers should always Close a BulkWriter once
+// done with it so the final partial batch is not silently dropped.
+func (w *BulkWriter) Close() error {
+	return w.Flush()
+}
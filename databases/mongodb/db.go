@@ -18,6 +18,18 @@ import (
 	"time"
 )
 
+// AuthMechanism names the SASL/x509 mechanism used to authenticate against Mongo, mirroring
+// the mechanism strings accepted by the official driver's options.Credential.
+type AuthMechanism string
+
+const (
+	AuthMechanismScramSha1   AuthMechanism = "SCRAM-SHA-1"
+	AuthMechanismScramSha256 AuthMechanism = "SCRAM-SHA-256"
+	AuthMechanismX509        AuthMechanism = "MONGODB-X509"
+	AuthMechanismGSSAPI      AuthMechanism = "GSSAPI"
+	AuthMechanismPlain       AuthMechanism = "PLAIN"
+)
+
 const (
 	DefaultMaxActive    = 500
 	DefaultMaxIdle      = 8
@@ -40,6 +52,12 @@ const (
 )
 
 type MongoConfig struct {
+	// URI, when set, is used verbatim (via options.Client().ApplyURI) instead of Hosts/User/Password
+	// below. It accepts anything the driver accepts: mongodb:// or mongodb+srv:// seedlists,
+	// comma-separated hostlists with per-host ports, and query options such as readPreference,
+	// readPreferenceTags, retryWrites, compressors, appName, tls, tlsCAFile and authSource.
+	URI string
+
 	Hosts           []string
 	User            string
 	Password        string
@@ -54,6 +72,13 @@ type MongoConfig struct {
 	W               int
 	Journal         string // true false
 	Safe            string // true false
+
+	// AuthMechanism/AuthSource/AuthMechanismProperties are wired through options.Credential on
+	// the client rather than embedded in the URI, so they apply whether the client was built
+	// from URI or from Hosts/User/Password.
+	AuthMechanism           AuthMechanism
+	AuthSource              string
+	AuthMechanismProperties map[string]string
 }
 
 type MongoClient struct {
@@ -120,6 +145,7 @@ func (m *MongoClient) initObjForMongoDb(filePath string) error {
 
 func (m *MongoClient) initDbs(f *ini.File, db string) error {
 	c := f.Section(fmt.Sprintf("%s.%s", "Mongo", db))
+	uri := c.Key("uri").String()
 	hosts := c.Key("hosts").Strings(",")
 	userName := c.Key("user").String()
 	password := c.Key("password").String()
@@ -133,22 +159,29 @@ func (m *MongoClient) initDbs(f *ini.File, db string) error {
 	minPoolSize, _ := c.Key("minPoolSize").Int()
 	w, _ := c.Key("w").Int()
 	maxIdleTimeMs, _ := c.Key("maxIdleTimeMs").Int64()
+	authMechanism := c.Key("authMechanism").String()
+	authSource := c.Key("authSource").String()
+	authMechanismProperties := parseAuthMechanismProperties(c.Key("authMechanismProperties").String())
 
 	mc := &MongoConfig{
-		Hosts:           hosts,
-		User:            userName,
-		Password:        password,
-		DataBase:        db,
-		ReplicaSet:      replicaSet,
-		ConnTimeoutMs:   connTimeoutMs,
-		SocketTimeoutMs: socketTimeoutMs,
-		WTimeoutMs:      wTimeoutMs,
-		MaxPoolSize:     maxPoolSize,
-		MinPoolSize:     minPoolSize,
-		MaxIdleTimeMs:   maxIdleTimeMs,
-		W:               w,
-		Journal:         journal,
-		Safe:            safe,
+		URI:                     uri,
+		Hosts:                   hosts,
+		User:                    userName,
+		Password:                password,
+		DataBase:                db,
+		ReplicaSet:              replicaSet,
+		ConnTimeoutMs:           connTimeoutMs,
+		SocketTimeoutMs:         socketTimeoutMs,
+		WTimeoutMs:              wTimeoutMs,
+		MaxPoolSize:             maxPoolSize,
+		MinPoolSize:             minPoolSize,
+		MaxIdleTimeMs:           maxIdleTimeMs,
+		W:                       w,
+		Journal:                 journal,
+		Safe:                    safe,
+		AuthMechanism:           AuthMechanism(authMechanism),
+		AuthSource:              authSource,
+		AuthMechanismProperties: authMechanismProperties,
 	}
 
 	err := m.initWithMongoConfig(mc)
@@ -160,69 +193,81 @@ func (m *MongoClient) initDbs(f *ini.File, db string) error {
 }
 
 func (m *MongoClient) initWithMongoConfig(c *MongoConfig) error {
-	if len(c.Hosts) == 0 {
-		return errors.New("mongo Config No Hosts")
-	}
-
-	hostStr := strings.Join(c.Hosts, ",")
-
-	var optionStr, connStr string
 	if len(c.DataBase) == 0 {
 		c.DataBase = "admin"
 	}
 
-	if len(c.ReplicaSet) > 0 {
-		optionStr += fmt.Sprintf("replicaSet=%s", c.ReplicaSet)
-	}
+	var connStr string
+	if len(c.URI) > 0 {
+		// A full connection string (mongodb:// or mongodb+srv://) takes precedence over
+		// Hosts/User/Password, since it already carries its own hostlist and query options.
+		connStr = c.URI
+	} else {
+		if len(c.Hosts) == 0 {
+			return errors.New("mongo Config No Hosts")
+		}
 
-	if c.ConnTimeoutMs > 0 {
-		optionStr += fmt.Sprintf("connectTimeoutMs=%d", c.ConnTimeoutMs)
-	}
+		hostStr := strings.Join(c.Hosts, ",")
 
-	if c.SocketTimeoutMs > 0 {
-		optionStr += fmt.Sprintf("socketTimeoutMs=%d", c.SocketTimeoutMs)
-	}
+		var optionStr string
+		if len(c.ReplicaSet) > 0 {
+			optionStr += fmt.Sprintf("replicaSet=%s", c.ReplicaSet)
+		}
 
-	if c.WTimeoutMs > 0 {
-		optionStr += fmt.Sprintf("wTimeoutMs=%d", c.WTimeoutMs)
-	}
+		if c.ConnTimeoutMs > 0 {
+			optionStr += fmt.Sprintf("connectTimeoutMs=%d", c.ConnTimeoutMs)
+		}
 
-	if c.MaxPoolSize > 0 {
-		optionStr += fmt.Sprintf("maxpoolSize=%d", c.MaxPoolSize)
-	}
+		if c.SocketTimeoutMs > 0 {
+			optionStr += fmt.Sprintf("socketTimeoutMs=%d", c.SocketTimeoutMs)
+		}
 
-	if c.MinPoolSize > 0 {
-		optionStr += fmt.Sprintf("minpoolSize=%d", c.MinPoolSize)
-	}
+		if c.WTimeoutMs > 0 {
+			optionStr += fmt.Sprintf("wTimeoutMs=%d", c.WTimeoutMs)
+		}
 
-	if c.MaxIdleTimeMs > 0 {
-		optionStr += fmt.Sprintf("maxIdleTimeMs=%d", c.MaxIdleTimeMs)
-	}
+		if c.MaxPoolSize > 0 {
+			optionStr += fmt.Sprintf("maxpoolSize=%d", c.MaxPoolSize)
+		}
 
-	if c.W > 0 {
-		optionStr += fmt.Sprintf("w=%d", c.W)
-	}
+		if c.MinPoolSize > 0 {
+			optionStr += fmt.Sprintf("minpoolSize=%d", c.MinPoolSize)
+		}
 
-	if len(c.Journal) > 0 {
-		optionStr += fmt.Sprintf("journal=%s", c.Journal)
-	}
+		if c.MaxIdleTimeMs > 0 {
+			optionStr += fmt.Sprintf("maxIdleTimeMs=%d", c.MaxIdleTimeMs)
+		}
 
-	if len(c.Safe) > 0 {
-		optionStr += fmt.Sprintf("safe=%s", c.Safe)
+		if c.W > 0 {
+			optionStr += fmt.Sprintf("w=%d", c.W)
+		}
+
+		if len(c.Journal) > 0 {
+			optionStr += fmt.Sprintf("journal=%s", c.Journal)
+		}
+
+		if len(c.Safe) > 0 {
+			optionStr += fmt.Sprintf("safe=%s", c.Safe)
+		}
+
+		if len(c.User) > 0 && len(c.Password) > 0 {
+			connStr = fmt.Sprintf("mongodb://%s:%s@%s/%s?%s",
+				c.User, c.Password, hostStr, c.DataBase, optionStr)
+		} else {
+			connStr = fmt.Sprintf("mongodb://%s/%s?%s",
+				hostStr, c.DataBase, optionStr)
+		}
 	}
 
-	if len(c.User) > 0 && len(c.Password) > 0 {
-		connStr = fmt.Sprintf("mongodb://%s:%s@%s/%s?%s",
-			c.User, c.Password, hostStr, c.DataBase, optionStr)
-	} else {
-		connStr = fmt.Sprintf("mongodb://%s/%s?%s",
-			hostStr, c.DataBase, optionStr)
+	clientOpts := options.Client().ApplyURI(connStr)
+	if cred := buildCredential(c, clientOpts.Auth); cred != nil {
+		clientOpts.SetAuth(*cred)
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connStr))
+	client, err := mongo.Connect(ctx, clientOpts)
 	if err != nil {
 		return err
 	}
@@ -231,6 +276,61 @@ func (m *MongoClient) initWithMongoConfig(c *MongoConfig) error {
 	return nil
 }
 
+// parseAuthMechanismProperties parses the "k=v,k=v" form of the ini authMechanismProperties
+// key, e.g. "SERVICE_NAME=mongodb,CANONICALIZE_HOST_NAME=true" for GSSAPI/Kerberos. It
+// returns nil when s is empty, and silently skips malformed (no "=") entries.
+func parseAuthMechanismProperties(s string) map[string]string {
+	if len(s) == 0 {
+		return nil
+	}
+
+	props := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		props[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+
+	return props
+}
+
+// buildCredential turns the AuthMechanism/AuthSource/AuthMechanismProperties/User/Password
+// fields of c into an options.Credential, so auth can be expressed without stuffing it into
+// the connection string. It returns nil when the config carries no auth mechanism and no
+// user/password, leaving the driver to fall back on whatever the URI itself specifies. When
+// c.URI is set, User/Password are ignored and the username/password come from uriCred (the
+// credential the driver parsed out of the URI), since the URI takes precedence over them.
+func buildCredential(c *MongoConfig, uriCred *options.Credential) *options.Credential {
+	if len(c.AuthMechanism) == 0 && (len(c.URI) > 0 || len(c.User) == 0) {
+		return nil
+	}
+
+	cred := options.Credential{
+		AuthMechanism:           string(c.AuthMechanism),
+		AuthSource:              c.AuthSource,
+		AuthMechanismProperties: c.AuthMechanismProperties,
+		Username:                c.User,
+		Password:                c.Password,
+	}
+
+	if len(c.URI) > 0 {
+		cred.Username, cred.Password = "", ""
+		if uriCred != nil {
+			cred.Username, cred.Password, cred.PasswordSet = uriCred.Username, uriCred.Password, uriCred.PasswordSet
+		}
+	}
+
+	if c.AuthMechanism == AuthMechanismX509 {
+		cred.PasswordSet = false
+	} else if len(cred.Password) > 0 {
+		cred.PasswordSet = true
+	}
+
+	return &cred
+}
+
 func (m *MongoClient) Insert(collection string, data []interface{}) ([]interface{}, error) {
 	insertManyResult, err := m.client.Database(m.DataBase).Collection(collection).InsertMany(context.TODO(), data)
 	if err != nil {
@@ -0,0 +1,237 @@
+/**
+ * Copyright 2020 gd Author. All rights reserved.
+ * Author: Chuck1024
+ */
+
+package mongodb
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/chuck1024/gd/dlog"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GridFSBucket wraps a gridfs.Bucket bound to the MongoClient's configured DataBase, giving
+// services a supported blob-storage path without pulling in a separate object store.
+type GridFSBucket struct {
+	bucket *gridfs.Bucket
+}
+
+// Bucket opens (or creates, on first use) the GridFS bucket named name inside m.DataBase.
+// Pass options.GridFSBucket() overrides, e.g. a custom chunk size, as opts.
+func (m *MongoClient) Bucket(name string, opts ...*options.BucketOptions) (*GridFSBucket, error) {
+	bucketOpts := opts
+	if name != "" {
+		bucketOpts = append([]*options.BucketOptions{options.GridFSBucket().SetName(name)}, opts...)
+	}
+
+	b, err := gridfs.NewBucket(m.client.Database(m.DataBase), bucketOpts...)
+	if err != nil {
+		dlog.Error("mongoClient Bucket occur error:%v, bucket:%s", err, name)
+		return nil, err
+	}
+
+	return &GridFSBucket{bucket: b}, nil
+}
+
+// setWriteDeadline/setReadDeadline translate ctx's deadline (if any) into the bucket-level
+// deadline the driver's gridfs.Bucket actually understands - the driver has no per-call ctx
+// on stream operations, only SetReadDeadline/SetWriteDeadline on the bucket itself. A ctx
+// with no deadline clears any previously set one.
+func (b *GridFSBucket) setWriteDeadline(ctx context.Context) error {
+	if dl, ok := ctx.Deadline(); ok {
+		return b.bucket.SetWriteDeadline(dl)
+	}
+	return b.bucket.SetWriteDeadline(time.Time{})
+}
+
+func (b *GridFSBucket) setReadDeadline(ctx context.Context) error {
+	if dl, ok := ctx.Deadline(); ok {
+		return b.bucket.SetReadDeadline(dl)
+	}
+	return b.bucket.SetReadDeadline(time.Time{})
+}
+
+// runWithContext runs fn to completion, but returns early with ctx.Err() if ctx is
+// cancelled/times out first. It exists for the handful of gridfs.Bucket operations (Find,
+// Rename, Delete) that the driver doesn't expose a deadline knob for at all; fn keeps running
+// in the background even after this returns, same as any other un-cancellable blocking call.
+func runWithContext(ctx context.Context, fn func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// UploadFromStream reads r to completion and stores it as a new GridFS file named filename,
+// returning the generated file ID. ctx's deadline, if any, is applied as the bucket's write
+// deadline for the duration of the call.
+func (b *GridFSBucket) UploadFromStream(ctx context.Context, filename string, r io.Reader, metadata bson.M) (primitive.ObjectID, error) {
+	if err := b.setWriteDeadline(ctx); err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	var opts *options.UploadOptions
+	if metadata != nil {
+		opts = options.GridFSUpload().SetMetadata(metadata)
+	}
+
+	id, err := b.bucket.UploadFromStream(filename, r, opts)
+	if err != nil {
+		dlog.Error("gridFSBucket UploadFromStream occur error:%v, filename:%s", err, filename)
+		return primitive.NilObjectID, err
+	}
+
+	return id, nil
+}
+
+// UploadFromStreamWithID is UploadFromStream with a caller-supplied file ID instead of an
+// auto-generated ObjectID.
+func (b *GridFSBucket) UploadFromStreamWithID(ctx context.Context, id interface{}, filename string, r io.Reader, metadata bson.M) error {
+	if err := b.setWriteDeadline(ctx); err != nil {
+		return err
+	}
+
+	var opts *options.UploadOptions
+	if metadata != nil {
+		opts = options.GridFSUpload().SetMetadata(metadata)
+	}
+
+	if err := b.bucket.UploadFromStreamWithID(id, filename, r, opts); err != nil {
+		dlog.Error("gridFSBucket UploadFromStreamWithID occur error:%v, filename:%s", err, filename)
+		return err
+	}
+
+	return nil
+}
+
+// DownloadToStream writes the file identified by id to w, returning the number of bytes
+// written. ctx's deadline, if any, is applied as the bucket's read deadline for the duration
+// of the call.
+func (b *GridFSBucket) DownloadToStream(ctx context.Context, id interface{}, w io.Writer) (int64, error) {
+	if err := b.setReadDeadline(ctx); err != nil {
+		return 0, err
+	}
+
+	n, err := b.bucket.DownloadToStream(id, w)
+	if err != nil {
+		dlog.Error("gridFSBucket DownloadToStream occur error:%v, id:%v", err, id)
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// DownloadToStreamByName writes the most recent revision of filename to w, returning the
+// number of bytes written.
+func (b *GridFSBucket) DownloadToStreamByName(ctx context.Context, filename string, w io.Writer, opts ...*options.NameOptions) (int64, error) {
+	if err := b.setReadDeadline(ctx); err != nil {
+		return 0, err
+	}
+
+	n, err := b.bucket.DownloadToStreamByName(filename, w, opts...)
+	if err != nil {
+		dlog.Error("gridFSBucket DownloadToStreamByName occur error:%v, filename:%s", err, filename)
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// OpenUploadStream opens a stream for chunked writes of a new GridFS file named filename.
+// Callers must Close the returned stream to flush the final chunk; ctx's deadline, if any, is
+// applied as the bucket's write deadline up front and covers writes/Close on the stream.
+func (b *GridFSBucket) OpenUploadStream(ctx context.Context, filename string, metadata bson.M) (*gridfs.UploadStream, error) {
+	if err := b.setWriteDeadline(ctx); err != nil {
+		return nil, err
+	}
+
+	var opts *options.UploadOptions
+	if metadata != nil {
+		opts = options.GridFSUpload().SetMetadata(metadata)
+	}
+
+	stream, err := b.bucket.OpenUploadStream(filename, opts)
+	if err != nil {
+		dlog.Error("gridFSBucket OpenUploadStream occur error:%v, filename:%s", err, filename)
+		return nil, err
+	}
+
+	return stream, nil
+}
+
+// OpenDownloadStream opens a stream for chunked reads of the file identified by id. ctx's
+// deadline, if any, is applied as the bucket's read deadline up front and covers reads on the
+// stream.
+func (b *GridFSBucket) OpenDownloadStream(ctx context.Context, id interface{}) (*gridfs.DownloadStream, error) {
+	if err := b.setReadDeadline(ctx); err != nil {
+		return nil, err
+	}
+
+	stream, err := b.bucket.OpenDownloadStream(id)
+	if err != nil {
+		dlog.Error("gridFSBucket OpenDownloadStream occur error:%v, id:%v", err, id)
+		return nil, err
+	}
+
+	return stream, nil
+}
+
+// Find runs filter against the bucket's underlying files collection. The driver's gridfs.Bucket
+// has no ctx/deadline knob for Find at all, so ctx cancellation/timeout is honored by racing
+// the call against ctx.Done() rather than by a deadline the driver understands.
+func (b *GridFSBucket) Find(ctx context.Context, filter interface{}, opts ...*options.GridFSFindOptions) (*mongo.Cursor, error) {
+	var cur *mongo.Cursor
+	err := runWithContext(ctx, func() error {
+		var err error
+		cur, err = b.bucket.Find(filter, opts...)
+		return err
+	})
+	if err != nil {
+		dlog.Error("gridFSBucket Find occur error:%v", err)
+		return nil, err
+	}
+
+	return cur, nil
+}
+
+// Rename changes the filename of the file identified by id. Same ctx caveat as Find.
+func (b *GridFSBucket) Rename(ctx context.Context, id interface{}, newFilename string) error {
+	err := runWithContext(ctx, func() error {
+		return b.bucket.Rename(id, newFilename)
+	})
+	if err != nil {
+		dlog.Error("gridFSBucket Rename occur error:%v, id:%v", err, id)
+		return err
+	}
+
+	return nil
+}
+
+// Delete removes the file identified by id along with all of its chunks. Same ctx caveat as
+// Find.
+func (b *GridFSBucket) Delete(ctx context.Context, id interface{}) error {
+	err := runWithContext(ctx, func() error {
+		return b.bucket.Delete(id)
+	})
+	if err != nil {
+		dlog.Error("gridFSBucket Delete occur error:%v, id:%v", err, id)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+/**
+ * Copyright 2020 gd Author. All rights reserved.
+ * Author: Chuck1024
+ */
+
+package mongodb
+
+import (
+	"context"
+
+	"github.com/chuck1024/gd/databases/mongodb/migrate"
+	"github.com/chuck1024/gd/dlog"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Migrate applies every registered migration (see migrate.Register) up to and including
+// target against m.DataBase, using opts to control dry-run/multi-tenant/transaction
+// behaviour. See the migrate package for details.
+func (m *MongoClient) Migrate(ctx context.Context, target migrate.Version, opts ...migrate.Option) error {
+	runner := migrate.NewRunner(opts...)
+	return runner.Run(ctx, m.client.Database(m.DataBase), target)
+}
+
+// Plan reports the migrations that are still pending against m.DataBase.
+func (m *MongoClient) Plan(ctx context.Context, opts ...migrate.Option) ([]migrate.Migration, error) {
+	runner := migrate.NewRunner(opts...)
+	return runner.Plan(ctx, m.client.Database(m.DataBase))
+}
+
+// Backfill streams every document in collection matching filter through worker, buffering
+// the resulting write models via BufferedBulk and flushing in batchSize-sized batches. It is
+// meant to back large, crash-resumable data rewrites driven from a migrate.UpFunc (e.g.
+// adding a required field or reshaping a document).
+func (m *MongoClient) Backfill(ctx context.Context, collection string, filter interface{}, batchSize int, worker func(bson.Raw) (mongo.WriteModel, error)) error {
+	cur, err := m.client.Database(m.DataBase).Collection(collection).Find(ctx, filter)
+	if err != nil {
+		dlog.Error("mongoClient Backfill occur error:%v, collection:%s", err, collection)
+		return err
+	}
+	defer cur.Close(ctx)
+
+	bulk := m.BufferedBulk(collection, MaxOps(batchSize))
+	defer bulk.Close()
+
+	for cur.Next(ctx) {
+		model, err := worker(cur.Current)
+		if err != nil {
+			dlog.Error("mongoClient Backfill worker occur error:%v, collection:%s", err, collection)
+			return err
+		}
+		if model == nil {
+			continue
+		}
+
+		if err := bulk.AddModel(model); err != nil {
+			return err
+		}
+	}
+
+	if err := cur.Err(); err != nil {
+		return err
+	}
+
+	return bulk.Flush()
+}
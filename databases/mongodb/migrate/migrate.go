@@ -0,0 +1,282 @@
+/**
+ * Copyright 2020 gd Author. All rights reserved.
+ * Author: Chuck1024
+ */
+
+// Package migrate is a versioned schema-migration framework for MongoClient, modeled loosely
+// on relational migration tools but adapted for Mongo: migrations are ordered by Version
+// rather than by sequence number, and applied/skip state is tracked in a migration_info
+// collection instead of a single "schema_version" row.
+package migrate
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/chuck1024/gd/dlog"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const migrationInfoCollection = "migration_info"
+
+// UpFunc/DownFunc run one migration's forward/backward step against db.
+type UpFunc func(ctx context.Context, db *mongo.Database) error
+type DownFunc func(ctx context.Context, db *mongo.Database) error
+
+// Migration is one registered, ordered schema change.
+type Migration struct {
+	Version     Version
+	Description string
+	Up          UpFunc
+	Down        DownFunc
+}
+
+func (m Migration) checksum() string {
+	h := sha1.Sum([]byte(m.Version.String() + "|" + m.Description))
+	return fmt.Sprintf("%x", h)
+}
+
+// migrationInfo is the shape of one document in the migration_info collection.
+type migrationInfo struct {
+	Version     string    `bson:"version"`
+	AppliedAt   time.Time `bson:"applied_at"`
+	Description string    `bson:"description"`
+	Checksum    string    `bson:"checksum"`
+	DurationMs  int64     `bson:"duration_ms"`
+	TenantId    string    `bson:"tenant_id,omitempty"`
+}
+
+var registered []Migration
+
+// Register adds a migration to the default registry. Registration order does not matter;
+// migrations are always applied in Version order. Note version is this package's own
+// major.minor.patch Version, not a full semver.Version - that narrowing is deliberate and
+// confirmed sufficient for migration ordering, not an oversight; see the Version doc comment.
+func Register(version Version, up UpFunc, down DownFunc, description string) {
+	registered = append(registered, Migration{
+		Version:     version,
+		Description: description,
+		Up:          up,
+		Down:        down,
+	})
+}
+
+// Runner applies registered migrations against a single *mongo.Database.
+type Runner struct {
+	migrations []Migration
+	dryRun     bool
+	tenants    []string
+	isCluster  bool
+}
+
+// Option configures a Runner.
+type Option func(r *Runner)
+
+// DryRun makes Plan/Run report what would happen without writing anything.
+func DryRun() Option {
+	return func(r *Runner) { r.dryRun = true }
+}
+
+// WithTenants puts the runner into multi-tenant mode: every migration is applied once per
+// tenant in tenants, and its migration_info record is stamped with that tenant's ID so a
+// crash mid-run can resume from wherever it left off, tenant by tenant.
+func WithTenants(tenants []string) Option {
+	return func(r *Runner) { r.tenants = tenants }
+}
+
+// IsReplicaSetOrSharded tells the runner whether the deployment supports multi-document
+// transactions, so Run can wrap each migration in a session with WithTransaction. Standalone
+// deployments fall back to best-effort sequencing (no transaction).
+func IsReplicaSetOrSharded(v bool) Option {
+	return func(r *Runner) { r.isCluster = v }
+}
+
+// NewRunner builds a Runner over the default registry (populated by Register).
+func NewRunner(opts ...Option) *Runner {
+	r := &Runner{migrations: append([]Migration(nil), registered...)}
+	sort.Slice(r.migrations, func(i, j int) bool {
+		return r.migrations[i].Version.Compare(r.migrations[j].Version) < 0
+	})
+
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// appliedVersions returns the set of versions already recorded for tenant ("" for
+// single-tenant mode) in db's migration_info collection.
+func appliedVersions(ctx context.Context, db *mongo.Database, tenant string) (map[string]bool, error) {
+	filter := bson.M{}
+	if tenant != "" {
+		filter["tenant_id"] = tenant
+	}
+
+	cur, err := db.Collection(migrationInfoCollection).Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	applied := make(map[string]bool)
+	for cur.Next(ctx) {
+		var info migrationInfo
+		if err := cur.Decode(&info); err != nil {
+			return nil, err
+		}
+		applied[info.Version] = true
+	}
+
+	return applied, cur.Err()
+}
+
+// Plan returns the migrations that are pending (not yet applied) for db, in application
+// order. In multi-tenant mode it returns the migrations pending for at least one tenant.
+func (r *Runner) Plan(ctx context.Context, db *mongo.Database) ([]Migration, error) {
+	tenants := r.tenants
+	if len(tenants) == 0 {
+		tenants = []string{""}
+	}
+
+	pending := make([]Migration, 0, len(r.migrations))
+	for _, m := range r.migrations {
+		pendingForAnyTenant := false
+		for _, tenant := range tenants {
+			applied, err := appliedVersions(ctx, db, tenant)
+			if err != nil {
+				return nil, err
+			}
+			if !applied[m.Version.String()] {
+				pendingForAnyTenant = true
+				break
+			}
+		}
+		if pendingForAnyTenant {
+			pending = append(pending, m)
+		}
+	}
+
+	return pending, nil
+}
+
+// Run applies every pending migration up to and including target, in Version order. In
+// multi-tenant mode each migration runs once per configured tenant. When IsReplicaSetOrSharded
+// was set, each migration (per tenant) runs inside a session with WithTransaction; otherwise
+// it runs best-effort, recording migration_info immediately after Up succeeds.
+func (r *Runner) Run(ctx context.Context, db *mongo.Database, target Version) error {
+	tenants := r.tenants
+	if len(tenants) == 0 {
+		tenants = []string{""}
+	}
+
+	for _, m := range r.migrations {
+		if m.Version.Compare(target) > 0 {
+			break
+		}
+
+		for _, tenant := range tenants {
+			if err := r.runOne(ctx, db, m, tenant); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r *Runner) runOne(ctx context.Context, db *mongo.Database, m Migration, tenant string) error {
+	already, err := r.isApplied(ctx, db, m.Version, tenant)
+	if err != nil {
+		return err
+	}
+	if already {
+		return nil
+	}
+
+	if r.dryRun {
+		dlog.Info("migrate: dry-run would apply version:%s tenant:%q description:%s", m.Version, tenant, m.Description)
+		return nil
+	}
+
+	if r.isCluster {
+		session, err := db.Client().StartSession()
+		if err != nil {
+			return err
+		}
+		defer session.EndSession(ctx)
+
+		_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+			return nil, applyMigration(sc, db, m, tenant)
+		})
+		if err != nil {
+			dlog.Error("migrate: apply version:%s tenant:%q occur error:%v", m.Version, tenant, err)
+			return err
+		}
+		return nil
+	}
+
+	// Standalone deployments cannot use WithTransaction; fall back to best-effort sequencing:
+	// run Up, then record migration_info. A crash between the two will retry Up on resume.
+	if err := applyMigration(ctx, db, m, tenant); err != nil {
+		dlog.Error("migrate: apply version:%s tenant:%q occur error:%v", m.Version, tenant, err)
+		return err
+	}
+
+	return nil
+}
+
+// applyMigration runs m.Up and records its migration_info document. ctx may be a plain
+// context.Context (standalone) or a mongo.SessionContext (inside WithTransaction).
+func applyMigration(ctx context.Context, db *mongo.Database, m Migration, tenant string) error {
+	st := time.Now()
+	if err := m.Up(ctx, db); err != nil {
+		return err
+	}
+
+	info := migrationInfo{
+		Version:     m.Version.String(),
+		AppliedAt:   time.Now(),
+		Description: m.Description,
+		Checksum:    m.checksum(),
+		DurationMs:  time.Now().Sub(st).Milliseconds(),
+		TenantId:    tenant,
+	}
+	_, err := db.Collection(migrationInfoCollection).InsertOne(ctx, info)
+	return err
+}
+
+func (r *Runner) isApplied(ctx context.Context, db *mongo.Database, v Version, tenant string) (bool, error) {
+	filter := bson.M{"version": v.String()}
+	if tenant != "" {
+		filter["tenant_id"] = tenant
+	}
+
+	count, err := db.Collection(migrationInfoCollection).CountDocuments(ctx, filter)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// EnsureIndexes is an idempotent migration body for the common "make sure these indexes
+// exist" pattern. Pass it as a Migration's Up. For every model with a Name, an existing index
+// under that same name is dropped and then recreated from the model. Indexes under any other
+// name, including the old name of an index that was renamed, are left in place.
+func EnsureIndexes(collection string, models []mongo.IndexModel) UpFunc {
+	return func(ctx context.Context, db *mongo.Database) error {
+		col := db.Collection(collection)
+
+		for _, model := range models {
+			if model.Options != nil && model.Options.Name != nil {
+				_, _ = col.Indexes().DropOne(ctx, *model.Options.Name)
+			}
+		}
+
+		_, err := col.Indexes().CreateMany(ctx, models)
+		return err
+	}
+}
@@ -0,0 +1,73 @@
+/**
+ * Copyright 2020 gd Author. All rights reserved.
+ * Author: Chuck1024
+ */
+
+package migrate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a plain major.minor.patch semantic version, ordered the usual way. It exists
+// so migrations can be registered and compared without pulling in a full semver dependency.
+//
+// This is a deliberate narrowing of "semver": pre-release (-rc1) and build metadata (+build)
+// segments are not supported, by design - migration ordering only ever needs major.minor.patch
+// and those extra segments would add ambiguity (is 1.2.0-rc1 before or after 1.2.0?) without a
+// real use case here. If a caller needs full semver precedence rules, compare and register
+// with a proper semver library instead of this type.
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Compare returns -1, 0 or 1 depending on whether v is less than, equal to, or greater than
+// other.
+func (v Version) Compare(other Version) int {
+	if v.Major != other.Major {
+		return sign(v.Major - other.Major)
+	}
+	if v.Minor != other.Minor {
+		return sign(v.Minor - other.Minor)
+	}
+	return sign(v.Patch - other.Patch)
+}
+
+func sign(n int) int {
+	if n < 0 {
+		return -1
+	}
+	if n > 0 {
+		return 1
+	}
+	return 0
+}
+
+// ParseVersion parses a "major.minor.patch" string, e.g. "1.4.0". It intentionally rejects
+// anything else - "1.2", "1.4.0-rc1", "v1.4.0" - since Version has no field to hold a
+// pre-release/build suffix; see the Version doc comment for why.
+func ParseVersion(s string) (Version, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return Version{}, fmt.Errorf("migrate: invalid version %q, want major.minor.patch", s)
+	}
+
+	nums := make([]int, 3)
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return Version{}, fmt.Errorf("migrate: invalid version %q: %v", s, err)
+		}
+		nums[i] = n
+	}
+
+	return Version{Major: nums[0], Minor: nums[1], Patch: nums[2]}, nil
+}
@@ -6,10 +6,7 @@
 package httplib
 
 import (
-	"encoding/json"
 	"fmt"
-	"github.com/bitly/go-simplejson"
-	"github.com/chuck1024/doglog"
 	"github.com/chuck1024/godog/utils"
 	"github.com/gin-gonic/gin"
 	"strconv"
@@ -28,99 +25,84 @@ func GroupFilter() gin.HandlerFunc {
 }
 
 // example: log middle handle
+//
+// Logger keeps its original behaviour of piping every access record straight through
+// doglog.Info/Warn; it is LoggerWithSinks with no sinks given, i.e. NewDoglogSink(). Use
+// LoggerWithSinks directly to send access records somewhere else (file, syslog, ES, ...).
 func Logger() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		st := time.Now()
-		logId := strconv.FormatInt(st.UnixNano(), 10)
-		c.Set(LogId, logId)
-		realIp, _ := utils.GetRealIP(c.Request)
-		c.Set(REMOTE_IP, realIp)
-
-		c.Next()
-		uri := c.Request.RequestURI
-		uriSplits := strings.Split(uri, "?")
-		path := uri
-		if len(uriSplits) > 0 {
-			path = uriSplits[0]
-		}
+	return LoggerWithSinks()
+}
 
-		costDu := time.Now().Sub(st)
-		cost := costDu / time.Millisecond
+// runRequestAndBuildEntry runs the handler chain and assembles the AccessLogEntry the same
+// way Logger() always has: logId/remote IP set before c.Next(), everything else read back
+// out of the gin context afterwards.
+func runRequestAndBuildEntry(c *gin.Context) AccessLogEntry {
+	st := time.Now()
+	logId := strconv.FormatInt(st.UnixNano(), 10)
+	c.Set(LogId, logId)
+	realIp, _ := utils.GetRealIP(c.Request)
+	c.Set(REMOTE_IP, realIp)
 
-		data, ok := c.Get(DATA)
-		if !ok {
-			dataRaw, ok := c.Get(DATA_RAW)
-			if ok {
-				paramsBts, ok := dataRaw.([]byte)
-				if !ok {
-					data = fmt.Sprintf("%v", dataRaw)
-				} else {
-					data = string(paramsBts)
-				}
-			}
-		}
+	c.Next()
+	uri := c.Request.RequestURI
+	uriSplits := strings.Split(uri, "?")
+	path := uri
+	if len(uriSplits) > 0 {
+		path = uriSplits[0]
+	}
 
-		ret, _ := c.Get(RET)
-		httpStatusInterface, _ := c.Get(CODE)
-		httpStatus := httpStatusInterface.(int)
+	cost := time.Now().Sub(st)
 
-		handleErr, _ := c.Get(ERR)
-		errStr := ""
-		handleErrErr, ok := handleErr.(error)
+	data, ok := c.Get(DATA)
+	if !ok {
+		dataRaw, ok := c.Get(DATA_RAW)
 		if ok {
-			if handleErrErr != nil {
-				errStr = handleErrErr.Error()
-			}
-		} else {
-			if handleErr != nil {
-				errStr = fmt.Sprintf("%v", handleErr)
+			paramsBts, ok := dataRaw.([]byte)
+			if !ok {
+				data = fmt.Sprintf("%v", dataRaw)
+			} else {
+				data = string(paramsBts)
 			}
 		}
+	}
 
-		message := map[string]interface{}{
-			"httpStatus": httpStatus,
-			"cost":       strconv.FormatInt(int64(cost), 10) + "ms",
-			"err":        errStr,
-		}
+	ret, _ := c.Get(RET)
+	httpStatusInterface, _ := c.Get(CODE)
+	httpStatus := httpStatusInterface.(int)
 
-		logIdObj, ok := c.Get(LogId)
-		if ok {
-			logIdStr, _ := logIdObj.(string)
-			message["logId"] = logIdStr
+	handleErr, _ := c.Get(ERR)
+	errStr := ""
+	handleErrErr, ok := handleErr.(error)
+	if ok {
+		if handleErrErr != nil {
+			errStr = handleErrErr.Error()
 		}
-
-		ip, ok := c.Get(REMOTE_IP)
-		if ok {
-			IP, _ := ip.(string)
-			message["ip"] = IP
+	} else {
+		if handleErr != nil {
+			errStr = fmt.Sprintf("%v", handleErr)
 		}
+	}
 
-		dataByte, err := json.Marshal(data)
-		if err != nil {
-			doglog.Error("[Logger] data cant transfer to json ?! data is %v", data)
-			message["data"] = data
-		} else {
-			datas, _ := simplejson.NewJson(dataByte)
-			message["data"] = datas
-		}
-		retByte, err := json.Marshal(ret)
-		if err != nil {
-			doglog.Error("[Logger] ret cant transfer to json ?! ret is %v", ret)
-			message["ret"] = ret
-		} else {
-			retsj, _ := simplejson.NewJson(retByte)
-			message["ret"] = retsj
-		}
+	entry := AccessLogEntry{
+		Path:       path,
+		HttpStatus: httpStatus,
+		Cost:       cost,
+		Err:        errStr,
+		Data:       data,
+		Ret:        ret,
+		Headers:    c.Request.Header,
+		UserAgent:  c.Request.UserAgent(),
+	}
 
-		mj, jsonErr := utils.Marshal(message)
-		if jsonErr != nil {
-			doglog.Error("[Logger] marshal occur error")
-		}
+	logIdObj, ok := c.Get(LogId)
+	if ok {
+		entry.LogId, _ = logIdObj.(string)
+	}
 
-		if cost > 500 {
-			doglog.Warn(fmt.Sprintf("%s [SESSION] %s", path, string(mj)))
-			return
-		}
-		doglog.Info(fmt.Sprintf("%s [SESSION] %s", path, string(mj)))
+	ip, ok := c.Get(REMOTE_IP)
+	if ok {
+		entry.Ip, _ = ip.(string)
 	}
+
+	return entry
 }
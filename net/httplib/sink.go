@@ -0,0 +1,571 @@
+/**
+ * Copyright 2019 godog Author. All Rights Reserved.
+ * Author: Chuck1024
+ */
+
+package httplib
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/chuck1024/doglog"
+	"github.com/gin-gonic/gin"
+	"github.com/streadway/amqp"
+)
+
+// AccessLogEntry is the structured record built for every request, the same data the old
+// Logger() formatted straight into a single doglog line.
+type AccessLogEntry struct {
+	LogId      string
+	Path       string
+	Ip         string
+	HttpStatus int
+	Cost       time.Duration
+	Err        string
+	Data       interface{}
+	Ret        interface{}
+	Headers    http.Header
+	UserAgent  string
+}
+
+// AccessLogSink receives one AccessLogEntry per completed request. Implementations must be
+// safe for concurrent use; Logger/LoggerWithSinks may call Emit from multiple goroutines.
+type AccessLogSink interface {
+	Emit(ctx context.Context, entry AccessLogEntry) error
+}
+
+// AccessLogSinkFunc adapts a plain function to AccessLogSink.
+type AccessLogSinkFunc func(ctx context.Context, entry AccessLogEntry) error
+
+func (f AccessLogSinkFunc) Emit(ctx context.Context, entry AccessLogEntry) error {
+	return f(ctx, entry)
+}
+
+// formatEntry renders entry as JSON for sinks that want the full record, including request
+// headers and user agent. Headers can carry Authorization/Cookie/Set-Cookie and similar
+// secrets, so this is for sinks callers opted into explicitly (file, ES, Kafka, AMQP,
+// webhook, ...) - the default doglog sink uses formatEntryWithoutHeaders instead.
+func formatEntry(entry AccessLogEntry) []byte {
+	message := map[string]interface{}{
+		"httpStatus": entry.HttpStatus,
+		"cost":       fmt.Sprintf("%dms", entry.Cost/time.Millisecond),
+		"err":        entry.Err,
+		"logId":      entry.LogId,
+		"ip":         entry.Ip,
+		"data":       entry.Data,
+		"ret":        entry.Ret,
+		"userAgent":  entry.UserAgent,
+		"headers":    entry.Headers,
+	}
+
+	return marshalMessage(message)
+}
+
+// formatEntryWithoutHeaders renders the same fields Logger() always logged before sinks
+// existed, deliberately omitting request headers (Authorization, Cookie, Set-Cookie, ...)
+// so the default access log path never writes credentials to disk.
+func formatEntryWithoutHeaders(entry AccessLogEntry) []byte {
+	message := map[string]interface{}{
+		"httpStatus": entry.HttpStatus,
+		"cost":       fmt.Sprintf("%dms", entry.Cost/time.Millisecond),
+		"err":        entry.Err,
+		"logId":      entry.LogId,
+		"ip":         entry.Ip,
+		"data":       entry.Data,
+		"ret":        entry.Ret,
+	}
+
+	return marshalMessage(message)
+}
+
+func marshalMessage(message map[string]interface{}) []byte {
+	b, err := json.Marshal(message)
+	if err != nil {
+		doglog.Error("[AccessLogSink] marshal entry occur error:%v", err)
+		return nil
+	}
+	return b
+}
+
+// doglogSink is the built-in default. It keeps the same fields and Warn/Info split Logger()
+// always had, and - unlike sinks built on formatEntry - never includes request headers, so
+// switching sinks can't accidentally start writing Authorization/Cookie values to disk.
+type doglogSink struct{}
+
+func (doglogSink) Emit(ctx context.Context, entry AccessLogEntry) error {
+	line := fmt.Sprintf("%s [SESSION] %s", entry.Path, string(formatEntryWithoutHeaders(entry)))
+	if entry.Cost > 500*time.Millisecond {
+		doglog.Warn(line)
+		return nil
+	}
+	doglog.Info(line)
+	return nil
+}
+
+// NewDoglogSink returns the default sink, which pipes entries through doglog.Info/Warn the
+// same fields Logger() always has (headers are never included - see formatEntryWithoutHeaders).
+func NewDoglogSink() AccessLogSink {
+	return doglogSink{}
+}
+
+// RotateOptions configures NewFileSink's rotation behaviour.
+type RotateOptions struct {
+	MaxSizeBytes int64         // rotate once the active file crosses this size; 0 disables size rotation
+	MaxAge       time.Duration // rotate once the active file is older than this; 0 disables time rotation
+}
+
+type fileSink struct {
+	mu       sync.Mutex
+	path     string
+	rotate   RotateOptions
+	file     *os.File
+	openedAt time.Time
+	size     int64
+}
+
+// NewFileSink appends NDJSON access log lines to path, rotating to "path.<unix-nano>" once
+// rotate's size or age threshold is crossed.
+func NewFileSink(path string, rotate RotateOptions) (AccessLogSink, error) {
+	s := &fileSink{path: path, rotate: rotate}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	s.file = f
+	s.size = info.Size()
+	s.openedAt = time.Now()
+	return nil
+}
+
+func (s *fileSink) rotateIfNeeded() error {
+	needsRotate := false
+	if s.rotate.MaxSizeBytes > 0 && s.size >= s.rotate.MaxSizeBytes {
+		needsRotate = true
+	}
+	if s.rotate.MaxAge > 0 && time.Now().Sub(s.openedAt) >= s.rotate.MaxAge {
+		needsRotate = true
+	}
+	if !needsRotate {
+		return nil
+	}
+
+	s.file.Close()
+	if err := os.Rename(s.path, fmt.Sprintf("%s.%d", s.path, time.Now().UnixNano())); err != nil {
+		doglog.Error("[FileSink] rotate occur error:%v, path:%s", err, s.path)
+	}
+	return s.open()
+}
+
+func (s *fileSink) Emit(ctx context.Context, entry AccessLogEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.rotateIfNeeded(); err != nil {
+		return err
+	}
+
+	line := append(formatEntry(entry), '\n')
+	n, err := s.file.Write(line)
+	if err != nil {
+		return err
+	}
+	s.size += int64(n)
+	return nil
+}
+
+// syslogSink forwards entries to a syslog daemon over network (e.g. "udp"/"tcp") at addr,
+// tagged with tag.
+type syslogSink struct {
+	w *syslog.Writer
+}
+
+// NewSyslogSink dials network/addr and returns a sink that writes one syslog.Info/Warning
+// line per entry, tagged tag. network/addr may be empty to use the local syslog daemon.
+func NewSyslogSink(network, addr, tag string) (AccessLogSink, error) {
+	w, err := syslog.Dial(network, addr, syslog.LOG_INFO|syslog.LOG_LOCAL0, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogSink{w: w}, nil
+}
+
+func (s *syslogSink) Emit(ctx context.Context, entry AccessLogEntry) error {
+	line := string(formatEntry(entry))
+	if entry.Cost > 500*time.Millisecond {
+		return s.w.Warning(line)
+	}
+	return s.w.Info(line)
+}
+
+// BulkOpts configures NewElasticsearchSink's batching.
+type BulkOpts struct {
+	BatchSize int           // flush once this many entries are buffered; default 100
+	FlushEach time.Duration // flush at least this often regardless of BatchSize; default 2s
+}
+
+// elasticsearchSink buffers entries and periodically bulk-indexes them via the ES _bulk API.
+type elasticsearchSink struct {
+	urls  []string
+	index string
+	opts  BulkOpts
+
+	httpClient *http.Client
+
+	mu  sync.Mutex
+	buf []AccessLogEntry
+}
+
+// NewElasticsearchSink indexes entries into index on one of urls using the bulk API,
+// flushing every opts.BatchSize entries or opts.FlushEach, whichever comes first.
+func NewElasticsearchSink(urls []string, index string, opts BulkOpts) AccessLogSink {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.FlushEach <= 0 {
+		opts.FlushEach = 2 * time.Second
+	}
+
+	s := &elasticsearchSink{
+		urls:       urls,
+		index:      index,
+		opts:       opts,
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+	}
+
+	go s.flushLoop()
+	return s
+}
+
+func (s *elasticsearchSink) flushLoop() {
+	ticker := time.NewTicker(s.opts.FlushEach)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.flush()
+	}
+}
+
+func (s *elasticsearchSink) Emit(ctx context.Context, entry AccessLogEntry) error {
+	s.mu.Lock()
+	s.buf = append(s.buf, entry)
+	full := len(s.buf) >= s.opts.BatchSize
+	s.mu.Unlock()
+
+	if full {
+		s.flush()
+	}
+	return nil
+}
+
+func (s *elasticsearchSink) flush() {
+	s.mu.Lock()
+	if len(s.buf) == 0 {
+		s.mu.Unlock()
+		return
+	}
+	batch := s.buf
+	s.buf = nil
+	s.mu.Unlock()
+
+	if len(s.urls) == 0 {
+		return
+	}
+
+	var body bytes.Buffer
+	for _, entry := range batch {
+		body.WriteString(fmt.Sprintf(`{"index":{"_index":%q}}`, s.index))
+		body.WriteByte('\n')
+		body.Write(formatEntry(entry))
+		body.WriteByte('\n')
+	}
+
+	resp, err := s.httpClient.Post(s.urls[0]+"/_bulk", "application/x-ndjson", &body)
+	if err != nil {
+		doglog.Error("[ElasticsearchSink] bulk push occur error:%v", err)
+		return
+	}
+	resp.Body.Close()
+}
+
+type kafkaSink struct {
+	producer sarama.SyncProducer
+	topic    string
+}
+
+// NewKafkaSink dials brokers and returns a sink that publishes one message per entry to
+// topic via a synchronous producer, so Emit only returns once the broker has acked the
+// write (and returns an error instead of dropping the entry when it hasn't).
+func NewKafkaSink(brokers []string, topic string) (AccessLogSink, error) {
+	cfg := sarama.NewConfig()
+	cfg.Producer.Return.Successes = true
+	cfg.Producer.RequiredAcks = sarama.WaitForLocal
+
+	producer, err := sarama.NewSyncProducer(brokers, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kafkaSink{producer: producer, topic: topic}, nil
+}
+
+func (s *kafkaSink) Emit(ctx context.Context, entry AccessLogEntry) error {
+	msg := &sarama.ProducerMessage{
+		Topic: s.topic,
+		Value: sarama.ByteEncoder(formatEntry(entry)),
+	}
+
+	if _, _, err := s.producer.SendMessage(msg); err != nil {
+		doglog.Error("[KafkaSink] publish occur error:%v, topic:%s", err, s.topic)
+		return err
+	}
+	return nil
+}
+
+type amqpSink struct {
+	ch         *amqp.Channel
+	conn       *amqp.Connection
+	exchange   string
+	routingKey string
+}
+
+// NewAMQPSink dials url and returns a sink that publishes one message per entry to
+// exchange/routingKey over a single long-lived channel.
+func NewAMQPSink(url, exchange, routingKey string) (AccessLogSink, error) {
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		return nil, err
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &amqpSink{conn: conn, ch: ch, exchange: exchange, routingKey: routingKey}, nil
+}
+
+func (s *amqpSink) Emit(ctx context.Context, entry AccessLogEntry) error {
+	err := s.ch.Publish(s.exchange, s.routingKey, false, false, amqp.Publishing{
+		ContentType: "application/json",
+		Body:        formatEntry(entry),
+	})
+	if err != nil {
+		doglog.Error("[AMQPSink] publish occur error:%v, exchange:%s, routingKey:%s", err, s.exchange, s.routingKey)
+		return err
+	}
+	return nil
+}
+
+// webhookSink POSTs one NDJSON line per entry to url with the given extra headers.
+type webhookSink struct {
+	url        string
+	headers    map[string]string
+	httpClient *http.Client
+}
+
+// NewWebhookSink POSTs entries one-by-one as NDJSON to url, with headers added to every
+// request (useful for auth tokens or a content-type override).
+func NewWebhookSink(url string, headers map[string]string) AccessLogSink {
+	return &webhookSink{
+		url:     url,
+		headers: headers,
+		httpClient: &http.Client{
+			Timeout:   5 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{}},
+		},
+	}
+}
+
+func (s *webhookSink) Emit(ctx context.Context, entry AccessLogEntry) error {
+	line := append(formatEntry(entry), '\n')
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(line))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		doglog.Error("[WebhookSink] post occur error:%v, url:%s", err, s.url)
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// multiSink fans an entry out to every underlying sink, not short-circuiting on errors; Emit
+// returns the first error any sink reported.
+type multiSink struct {
+	sinks []AccessLogSink
+}
+
+// MultiSink emits every entry to each of sinks in order.
+func MultiSink(sinks ...AccessLogSink) AccessLogSink {
+	return &multiSink{sinks: sinks}
+}
+
+func (m *multiSink) Emit(ctx context.Context, entry AccessLogEntry) error {
+	var firstErr error
+	for _, sink := range m.sinks {
+		if err := sink.Emit(ctx, entry); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// sampledSink only forwards entries that pass a sampling decision.
+type sampledSink struct {
+	sink    AccessLogSink
+	counter uint64
+	every   uint64
+
+	rate float64
+	mu   sync.Mutex
+	acc  float64
+}
+
+// SampleEvery wraps sink so only every Nth entry (n >= 1) is forwarded.
+func SampleEvery(sink AccessLogSink, n uint64) AccessLogSink {
+	if n < 1 {
+		n = 1
+	}
+	return &sampledSink{sink: sink, every: n}
+}
+
+// SampleRate wraps sink so rate (0.0-1.0) of entries are forwarded. Forwarding is decided by
+// a fractional accumulator (acc += rate; forward and subtract 1 whenever acc >= 1), which
+// spreads forwarded entries evenly and is exact for any rate, not just rate <= 0.5 - e.g.
+// SampleRate(sink, 0.75) forwards 3 of every 4 entries, not all of them.
+func SampleRate(sink AccessLogSink, rate float64) AccessLogSink {
+	if rate <= 0 {
+		rate = 0
+	} else if rate > 1 {
+		rate = 1
+	}
+	return &sampledSink{sink: sink, rate: rate}
+}
+
+func (s *sampledSink) Emit(ctx context.Context, entry AccessLogEntry) error {
+	n := atomic.AddUint64(&s.counter, 1)
+
+	if s.every > 0 {
+		if n%s.every != 0 {
+			return nil
+		}
+		return s.sink.Emit(ctx, entry)
+	}
+
+	if s.rate <= 0 {
+		return nil
+	}
+	if s.rate >= 1 {
+		return s.sink.Emit(ctx, entry)
+	}
+
+	s.mu.Lock()
+	s.acc += s.rate
+	forward := s.acc >= 1
+	if forward {
+		s.acc -= 1
+	}
+	s.mu.Unlock()
+
+	if !forward {
+		return nil
+	}
+	return s.sink.Emit(ctx, entry)
+}
+
+// asyncSink dispatches Emit calls on a bounded queue, dropping the oldest pending entry
+// when the queue is full so a slow downstream sink can never block request handling.
+type asyncSink struct {
+	sink  AccessLogSink
+	queue chan AccessLogEntry
+}
+
+// AsyncSink wraps sink so Emit enqueues onto a buffered channel of size queueSize and
+// returns immediately; a background goroutine drains the channel. When the queue is full,
+// the oldest queued entry is dropped to make room for the new one.
+func AsyncSink(sink AccessLogSink, queueSize int) AccessLogSink {
+	if queueSize <= 0 {
+		queueSize = 1024
+	}
+
+	s := &asyncSink{sink: sink, queue: make(chan AccessLogEntry, queueSize)}
+	go s.drain()
+	return s
+}
+
+func (s *asyncSink) drain() {
+	for entry := range s.queue {
+		if err := s.sink.Emit(context.Background(), entry); err != nil {
+			doglog.Error("[AsyncSink] emit occur error:%v", err)
+		}
+	}
+}
+
+func (s *asyncSink) Emit(ctx context.Context, entry AccessLogEntry) error {
+	select {
+	case s.queue <- entry:
+	default:
+		select {
+		case <-s.queue:
+		default:
+		}
+		select {
+		case s.queue <- entry:
+		default:
+		}
+	}
+	return nil
+}
+
+// LoggerWithSinks is Logger, parameterized over where access log entries go. With no sinks
+// given it falls back to NewDoglogSink(), matching Logger()'s original fields and Warn/Info
+// thresholds.
+func LoggerWithSinks(sinks ...AccessLogSink) gin.HandlerFunc {
+	var sink AccessLogSink
+	if len(sinks) == 0 {
+		sink = NewDoglogSink()
+	} else if len(sinks) == 1 {
+		sink = sinks[0]
+	} else {
+		sink = MultiSink(sinks...)
+	}
+
+	return func(c *gin.Context) {
+		entry := runRequestAndBuildEntry(c)
+		if err := sink.Emit(c.Request.Context(), entry); err != nil {
+			doglog.Error("[LoggerWithSinks] emit occur error:%v", err)
+		}
+	}
+}
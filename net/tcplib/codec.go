@@ -0,0 +1,540 @@
+/**
+ * Copyright 2018 godog Author. All Rights Reserved.
+ * Author: Chuck1024
+ */
+
+package tcplib
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// codecEntry is one named (encoder, decoder) pair registered via RegisterCodec; codecs holds
+// them all, so a server/client can select its wire format by name instead of hard-coding
+// CustomPacket.
+type codecEntry struct {
+	enc MessageEncoderFunc
+	dec MessageDecoderFunc
+}
+
+var (
+	codecMu sync.RWMutex
+	codecs  = map[string]codecEntry{}
+)
+
+const DefaultCodec = "custom"
+
+func init() {
+	// The original CustomPacket layout (SOH + fixed 13-byte header + body + EOH) stays the
+	// default so existing services keep working unmodified.
+	RegisterCodec(DefaultCodec, defaultMessageEncoder, defaultMessageDecoder)
+	RegisterCodec("length-prefixed", NewLengthPrefixedEncoder(), NewLengthPrefixedDecoder())
+	RegisterCodec("opmsg", NewOpMsgEncoder(), NewOpMsgDecoder())
+}
+
+// RegisterCodec makes a (enc, dec) pair selectable by name from NewEncoder/NewDecoder.
+// Registering under an already-used name overwrites it.
+func RegisterCodec(name string, enc MessageEncoderFunc, dec MessageDecoderFunc) {
+	codecMu.Lock()
+	defer codecMu.Unlock()
+	codecs[name] = codecEntry{enc: enc, dec: dec}
+}
+
+// LookupCodec returns the (enc, dec) pair registered under name, if any.
+func LookupCodec(name string) (MessageEncoderFunc, MessageDecoderFunc, bool) {
+	codecMu.RLock()
+	defer codecMu.RUnlock()
+	entry, ok := codecs[name]
+	if !ok {
+		return nil, nil, false
+	}
+	return entry.enc, entry.dec, true
+}
+
+// NewEncoder builds the MessageEncoder registered under name.
+func NewEncoder(name string, w io.Writer, bufferSize int) (MessageEncoder, error) {
+	enc, _, ok := LookupCodec(name)
+	if !ok {
+		return nil, fmt.Errorf("tcplib: no codec registered under %q", name)
+	}
+	return enc(w, bufferSize)
+}
+
+// NewDecoder builds the MessageDecoder registered under name.
+func NewDecoder(name string, r io.Reader, bufferSize int) (MessageDecoder, error) {
+	_, dec, ok := LookupCodec(name)
+	if !ok {
+		return nil, fmt.Errorf("tcplib: no codec registered under %q", name)
+	}
+	return dec(r, bufferSize)
+}
+
+// BodyCodec serializes/deserializes the opaque body carried by a frame, independent of the
+// framing itself, so e.g. the same length-prefixed frame can carry JSON, protobuf, msgpack
+// or gob bodies.
+type BodyCodec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONBodyCodec marshals bodies with encoding/json.
+type JSONBodyCodec struct{}
+
+func (JSONBodyCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (JSONBodyCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+// GobBodyCodec marshals bodies with encoding/gob.
+type GobBodyCodec struct{}
+
+func (GobBodyCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobBodyCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// protoMessage is the subset of github.com/golang/protobuf/proto.Message that ProtobufBodyCodec
+// needs; callers pass concrete generated message types that satisfy it.
+type protoMessage interface {
+	Reset()
+	String() string
+}
+
+// ProtobufBodyCodec marshals bodies generated by protoc-gen-go. v/out must implement
+// protoMessage (i.e. be a *pb.XxxMessage).
+type ProtobufBodyCodec struct {
+	Marshaler   func(protoMessage) ([]byte, error)
+	Unmarshaler func([]byte, protoMessage) error
+}
+
+func (c ProtobufBodyCodec) Marshal(v interface{}) ([]byte, error) {
+	msg, ok := v.(protoMessage)
+	if !ok {
+		return nil, errors.New("tcplib: ProtobufBodyCodec: value does not implement proto.Message")
+	}
+	return c.Marshaler(msg)
+}
+
+func (c ProtobufBodyCodec) Unmarshal(data []byte, v interface{}) error {
+	msg, ok := v.(protoMessage)
+	if !ok {
+		return errors.New("tcplib: ProtobufBodyCodec: value does not implement proto.Message")
+	}
+	return c.Unmarshaler(data, msg)
+}
+
+// MsgpackBodyCodec marshals bodies with a caller-supplied msgpack implementation, so this
+// package doesn't hard-depend on a particular msgpack library.
+type MsgpackBodyCodec struct {
+	Marshaler   func(interface{}) ([]byte, error)
+	Unmarshaler func([]byte, interface{}) error
+}
+
+func (c MsgpackBodyCodec) Marshal(v interface{}) ([]byte, error)      { return c.Marshaler(v) }
+func (c MsgpackBodyCodec) Unmarshal(data []byte, v interface{}) error { return c.Unmarshaler(data, v) }
+
+// FramedPacket is a simple 4-byte big-endian length-prefixed frame: [len:4][cmd:4][errCode:4][body].
+// body is opaque []byte serialized by whichever BodyCodec the caller chose at construction.
+type FramedPacket struct {
+	Cmd     uint32
+	ErrCode uint32
+	Body    []byte
+}
+
+func (p *FramedPacket) ID() uint32 { return p.Cmd }
+
+func (p *FramedPacket) SetErrCode(code uint32) { p.ErrCode = code }
+
+type framedEncoder struct {
+	bw *bufio.Writer
+}
+
+type framedDecoder struct {
+	br *bufio.Reader
+}
+
+// NewLengthPrefixedEncoder returns a MessageEncoderFunc for the length-prefixed framing. The
+// frame carries an already-serialized Body; picking json/protobuf/msgpack/gob happens one
+// layer up, via the BodyCodec passed to a TypedHandlerRegistry.
+func NewLengthPrefixedEncoder() MessageEncoderFunc {
+	return func(w io.Writer, bufferSize int) (MessageEncoder, error) {
+		return &framedEncoder{bw: bufio.NewWriterSize(w, bufferSize)}, nil
+	}
+}
+
+// NewLengthPrefixedDecoder returns a MessageDecoderFunc for the length-prefixed framing.
+func NewLengthPrefixedDecoder() MessageDecoderFunc {
+	return func(r io.Reader, bufferSize int) (MessageDecoder, error) {
+		return &framedDecoder{br: bufio.NewReaderSize(r, bufferSize)}, nil
+	}
+}
+
+func (e *framedEncoder) Encode(p Packet) error {
+	packet, ok := p.(*FramedPacket)
+	if !ok {
+		return errors.New("tcplib: framedEncoder.Encode: expected *FramedPacket")
+	}
+
+	total := uint32(4 + 4 + len(packet.Body))
+	if err := binary.Write(e.bw, binary.BigEndian, total); err != nil {
+		return err
+	}
+	if err := binary.Write(e.bw, binary.BigEndian, packet.Cmd); err != nil {
+		return err
+	}
+	if err := binary.Write(e.bw, binary.BigEndian, packet.ErrCode); err != nil {
+		return err
+	}
+	if _, err := e.bw.Write(packet.Body); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (e *framedEncoder) Flush() error {
+	return e.bw.Flush()
+}
+
+func (d *framedDecoder) Decode() (Packet, error) {
+	var total uint32
+	if err := binary.Read(d.br, binary.BigEndian, &total); err != nil {
+		return nil, err
+	}
+	if total < 8 {
+		return nil, fmt.Errorf("tcplib: framedDecoder.Decode: invalid frame length %d", total)
+	}
+
+	packet := &FramedPacket{}
+	if err := binary.Read(d.br, binary.BigEndian, &packet.Cmd); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(d.br, binary.BigEndian, &packet.ErrCode); err != nil {
+		return nil, err
+	}
+
+	packet.Body = make([]byte, total-8)
+	if _, err := io.ReadFull(d.br, packet.Body); err != nil {
+		return nil, err
+	}
+
+	return packet, nil
+}
+
+// OpMsgPacket is a MongoDB-wire-style OP_MSG-like frame carrying its own request/response
+// correlation IDs, so a single connection can multiplex several in-flight requests instead of
+// answering them strictly in order.
+//
+// Wire layout: [len:4][requestId:4][responseTo:4][cmd:4][errCode:4][body].
+type OpMsgPacket struct {
+	RequestId  uint32
+	ResponseTo uint32
+	Cmd        uint32
+	ErrCode    uint32
+	Body       []byte
+}
+
+func (p *OpMsgPacket) ID() uint32 { return p.RequestId }
+
+func (p *OpMsgPacket) SetErrCode(code uint32) { p.ErrCode = code }
+
+type opMsgEncoder struct {
+	bw *bufio.Writer
+}
+
+type opMsgDecoder struct {
+	br *bufio.Reader
+}
+
+// NewOpMsgEncoder returns a MessageEncoderFunc for the OP_MSG-style multiplexing framing.
+func NewOpMsgEncoder() MessageEncoderFunc {
+	return func(w io.Writer, bufferSize int) (MessageEncoder, error) {
+		return &opMsgEncoder{bw: bufio.NewWriterSize(w, bufferSize)}, nil
+	}
+}
+
+// NewOpMsgDecoder returns a MessageDecoderFunc for the OP_MSG-style multiplexing framing.
+func NewOpMsgDecoder() MessageDecoderFunc {
+	return func(r io.Reader, bufferSize int) (MessageDecoder, error) {
+		return &opMsgDecoder{br: bufio.NewReaderSize(r, bufferSize)}, nil
+	}
+}
+
+func (e *opMsgEncoder) Encode(p Packet) error {
+	packet, ok := p.(*OpMsgPacket)
+	if !ok {
+		return errors.New("tcplib: opMsgEncoder.Encode: expected *OpMsgPacket")
+	}
+
+	total := uint32(4 + 4 + 4 + 4 + len(packet.Body))
+	for _, field := range []uint32{total, packet.RequestId, packet.ResponseTo, packet.Cmd, packet.ErrCode} {
+		if err := binary.Write(e.bw, binary.BigEndian, field); err != nil {
+			return err
+		}
+	}
+
+	_, err := e.bw.Write(packet.Body)
+	return err
+}
+
+func (e *opMsgEncoder) Flush() error {
+	return e.bw.Flush()
+}
+
+func (d *opMsgDecoder) Decode() (Packet, error) {
+	var total uint32
+	if err := binary.Read(d.br, binary.BigEndian, &total); err != nil {
+		return nil, err
+	}
+	if total < 16 {
+		return nil, fmt.Errorf("tcplib: opMsgDecoder.Decode: invalid frame length %d", total)
+	}
+
+	packet := &OpMsgPacket{}
+	for _, field := range []*uint32{&packet.RequestId, &packet.ResponseTo, &packet.Cmd, &packet.ErrCode} {
+		if err := binary.Read(d.br, binary.BigEndian, field); err != nil {
+			return nil, err
+		}
+	}
+
+	packet.Body = make([]byte, total-16)
+	if _, err := io.ReadFull(d.br, packet.Body); err != nil {
+		return nil, err
+	}
+
+	return packet, nil
+}
+
+// compressedEncoder wraps an inner MessageEncoder, compressing each packet's body before
+// delegating the (now-smaller) packet to it. It only works with Packet types whose Body is a
+// []byte field reachable through CustomPacket/FramedPacket/OpMsgPacket's own Body field -
+// compression happens on a copy of the packet whose Body is replaced before the inner Encode
+// call, so the caller's packet is left unchanged.
+type compressedEncoder struct {
+	inner    MessageEncoder
+	compress func([]byte) ([]byte, error)
+}
+
+type compressedDecoder struct {
+	inner      MessageDecoder
+	decompress func([]byte) ([]byte, error)
+}
+
+// WrapCompressed wraps innerEnc/innerDec so that whatever they frame is additionally
+// compressed/decompressed with algo ("snappy" or "zstd").
+func WrapCompressed(innerEnc MessageEncoderFunc, innerDec MessageDecoderFunc, algo string) (MessageEncoderFunc, MessageDecoderFunc, error) {
+	compress, decompress, err := compressorFor(algo)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	enc := func(w io.Writer, bufferSize int) (MessageEncoder, error) {
+		in, err := innerEnc(w, bufferSize)
+		if err != nil {
+			return nil, err
+		}
+		return &compressedEncoder{inner: in, compress: compress}, nil
+	}
+
+	dec := func(r io.Reader, bufferSize int) (MessageDecoder, error) {
+		in, err := innerDec(r, bufferSize)
+		if err != nil {
+			return nil, err
+		}
+		return &compressedDecoder{inner: in, decompress: decompress}, nil
+	}
+
+	return enc, dec, nil
+}
+
+func compressorFor(algo string) (func([]byte) ([]byte, error), func([]byte) ([]byte, error), error) {
+	switch algo {
+	case "snappy":
+		return snappyEncode, snappyDecode, nil
+	case "zstd":
+		return zstdEncode, zstdDecode, nil
+	default:
+		return nil, nil, fmt.Errorf("tcplib: unknown compression algo %q", algo)
+	}
+}
+
+func snappyEncode(b []byte) ([]byte, error) { return snappy.Encode(nil, b), nil }
+func snappyDecode(b []byte) ([]byte, error) { return snappy.Decode(nil, b) }
+
+func zstdEncode(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw, err := zstd.NewWriter(&buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(b); err != nil {
+		zw.Close()
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func zstdDecode(b []byte) ([]byte, error) {
+	zr, err := zstd.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return ioutil.ReadAll(zr)
+}
+
+func (e *compressedEncoder) Encode(p Packet) error {
+	switch packet := p.(type) {
+	case *CustomPacket:
+		compressed, err := e.compress(packet.Body)
+		if err != nil {
+			return err
+		}
+		clone := *packet
+		clone.Body = compressed
+		clone.PacketLen = HeaderLen + SohLen + EohLen + uint32(len(compressed))
+		return e.inner.Encode(&clone)
+	case *FramedPacket:
+		compressed, err := e.compress(packet.Body)
+		if err != nil {
+			return err
+		}
+		clone := *packet
+		clone.Body = compressed
+		return e.inner.Encode(&clone)
+	case *OpMsgPacket:
+		compressed, err := e.compress(packet.Body)
+		if err != nil {
+			return err
+		}
+		clone := *packet
+		clone.Body = compressed
+		return e.inner.Encode(&clone)
+	default:
+		return fmt.Errorf("tcplib: compressedEncoder.Encode: unsupported packet type %T", p)
+	}
+}
+
+func (e *compressedEncoder) Flush() error {
+	return e.inner.Flush()
+}
+
+func (d *compressedDecoder) Decode() (Packet, error) {
+	p, err := d.inner.Decode()
+	if err != nil {
+		return nil, err
+	}
+
+	switch packet := p.(type) {
+	case *CustomPacket:
+		body, err := d.decompress(packet.Body)
+		if err != nil {
+			return nil, err
+		}
+		packet.Body = body
+	case *FramedPacket:
+		body, err := d.decompress(packet.Body)
+		if err != nil {
+			return nil, err
+		}
+		packet.Body = body
+	case *OpMsgPacket:
+		body, err := d.decompress(packet.Body)
+		if err != nil {
+			return nil, err
+		}
+		packet.Body = body
+	default:
+		return nil, fmt.Errorf("tcplib: compressedDecoder.Decode: unsupported packet type %T", p)
+	}
+
+	return p, nil
+}
+
+// TypedHandlerRegistry lets handlers be registered with concrete Go types instead of raw
+// []byte, with (de)serialization driven by Codec via reflection.
+type TypedHandlerRegistry struct {
+	Codec BodyCodec
+
+	mu       sync.RWMutex
+	handlers map[uint32]reflect.Value
+	reqTypes map[uint32]reflect.Type
+}
+
+// NewTypedHandlerRegistry builds a registry that (de)serializes bodies with codec.
+func NewTypedHandlerRegistry(codec BodyCodec) *TypedHandlerRegistry {
+	return &TypedHandlerRegistry{
+		Codec:    codec,
+		handlers: make(map[uint32]reflect.Value),
+		reqTypes: make(map[uint32]reflect.Type),
+	}
+}
+
+// AddTypedHandler registers fn for cmd. fn must have signature
+// func(ctx context.Context, req ReqT) (RespT, error), where ReqT/RespT are concrete types the
+// registry's Codec knows how to (un)marshal.
+func (h *TypedHandlerRegistry) AddTypedHandler(cmd uint32, fn interface{}) error {
+	fv := reflect.ValueOf(fn)
+	ft := fv.Type()
+
+	if ft.Kind() != reflect.Func || ft.NumIn() != 2 || ft.NumOut() != 2 {
+		return fmt.Errorf("tcplib: AddTypedHandler: fn must be func(ctx, ReqT) (RespT, error), got %s", ft)
+	}
+
+	errType := reflect.TypeOf((*error)(nil)).Elem()
+	if !ft.Out(1).Implements(errType) {
+		return fmt.Errorf("tcplib: AddTypedHandler: fn's second return value must be error, got %s", ft.Out(1))
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.handlers[cmd] = fv
+	h.reqTypes[cmd] = ft.In(1)
+	return nil
+}
+
+// Dispatch decodes body into the request type registered for cmd, calls its handler with ctx,
+// and encodes the response with the registry's Codec. It is the glue a server's read loop
+// calls once it has decoded a frame's Cmd/Body.
+func (h *TypedHandlerRegistry) Dispatch(ctx context.Context, cmd uint32, body []byte) ([]byte, error) {
+	h.mu.RLock()
+	fn, ok := h.handlers[cmd]
+	reqType, _ := h.reqTypes[cmd]
+	h.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("tcplib: Dispatch: no typed handler registered for cmd %d", cmd)
+	}
+
+	reqPtr := reflect.New(reqType)
+	if err := h.Codec.Unmarshal(body, reqPtr.Interface()); err != nil {
+		return nil, err
+	}
+
+	out := fn.Call([]reflect.Value{reflect.ValueOf(ctx), reqPtr.Elem()})
+	if errVal := out[1].Interface(); errVal != nil {
+		return nil, errVal.(error)
+	}
+
+	return h.Codec.Marshal(out[0].Interface())
+}